@@ -26,20 +26,70 @@ package bitstreamops
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 )
 
+// ErrBufferOverrun is returned by Collect (and friends) when the stream runs
+// out of buffered bits to read with no src to refill from.
+var ErrBufferOverrun = errors.New("Buffer overrun")
+
+// BitOrder selects how Emit/Collect pack bits into a byte.
+type BitOrder int
+
+const (
+	// BitOrderMSB packs the most significant bit of a value first, into the
+	// highest free bit of the current byte. This is the historical, default
+	// behavior of this package.
+	BitOrderMSB BitOrder = iota
+	// BitOrderLSB packs the least significant bit of a value first, into the
+	// lowest free bit of the current byte. This matches the bit ordering
+	// used by RFC 1951 DEFLATE, zlib, gzip and Zstandard's FSE/Huff0 streams.
+	BitOrderLSB
+)
+
 type BitStreamOps struct {
 	buf             []byte
 	index, bitindex uint
+	order           BitOrder
+
+	// acc/bitsInAcc back the Fill/FillFast/Peek/Advance/GetBits fast read
+	// path; wacc/wbits back the EmitFast/Flush fast write path. Both are
+	// zero-valued (and unused) until a caller opts into the fast path.
+	acc       uint64
+	bitsInAcc uint
+	wacc      uint64
+	wbits     uint
+
+	// src/dst back the io.Reader/io.Writer streaming mode (see
+	// NewBitStreamOpsStream); both are nil for the plain in-memory usage.
+	src io.Reader
+	dst io.Writer
 }
 
 func NewBitStreamOps() *BitStreamOps {
-	return &BitStreamOps{make([]byte, 1), 0, 0}
+	return &BitStreamOps{buf: make([]byte, 1), order: BitOrderMSB}
 }
 
 func NewBitStreamOpsReader(b []byte) *BitStreamOps {
-	return &BitStreamOps{b, 0, 0}
+	return &BitStreamOps{buf: b, order: BitOrderMSB}
+}
+
+// NewBitStreamOpsWithOrder is like NewBitStreamOps but lets the caller pick
+// the bit-packing order (see BitOrderMSB / BitOrderLSB).
+func NewBitStreamOpsWithOrder(order BitOrder) *BitStreamOps {
+	return &BitStreamOps{buf: make([]byte, 1), order: order}
+}
+
+// NewBitStreamOpsReaderWithOrder is like NewBitStreamOpsReader but lets the
+// caller pick the bit-packing order (see BitOrderMSB / BitOrderLSB).
+func NewBitStreamOpsReaderWithOrder(b []byte, order BitOrder) *BitStreamOps {
+	return &BitStreamOps{buf: b, order: order}
+}
+
+// Order reports the bit-packing order this BitStreamOps was constructed with.
+func (b *BitStreamOps) Order() BitOrder {
+	return b.order
 }
 
 func (b *BitStreamOps) Buffer() []byte {
@@ -105,11 +155,17 @@ func (b *BitStreamOps) Emit(val uint, numbits int) (err error) {
 	if numbits < 1 || numbits > 32 {
 		return errors.New("Invalid parameter value")
 	}
+
+	if b.order == BitOrderLSB {
+		return b.emitLSB(val, numbits)
+	}
+
 	for i := numbits - 1; i >= 0; i-- {
 		if b.bitindex == 8 {
 			b.buf = append(b.buf, 0)
 			b.index++
 			b.bitindex = 0
+			b.drain()
 		}
 
 		b.buf[b.index] |= byte(((val & (1 << uint(i))) >> uint(i)) << (7 - b.bitindex))
@@ -119,6 +175,33 @@ func (b *BitStreamOps) Emit(val uint, numbits int) (err error) {
 			b.buf = append(b.buf, 0)
 			b.index++
 			b.bitindex = 0
+			b.drain()
+		}
+	}
+
+	return nil
+}
+
+// emitLSB writes the low bit of val into the lowest currently-free bit
+// position of the current byte first, advancing upward -- the ordering
+// used by RFC 1951 DEFLATE, zlib, gzip and Zstd's FSE/Huff0 streams.
+func (b *BitStreamOps) emitLSB(val uint, numbits int) (err error) {
+	for i := 0; i < numbits; i++ {
+		if b.bitindex == 8 {
+			b.buf = append(b.buf, 0)
+			b.index++
+			b.bitindex = 0
+			b.drain()
+		}
+
+		b.buf[b.index] |= byte(((val & (1 << uint(i))) >> uint(i)) << b.bitindex)
+		b.bitindex++
+
+		if b.bitindex == 8 {
+			b.buf = append(b.buf, 0)
+			b.index++
+			b.bitindex = 0
+			b.drain()
 		}
 	}
 
@@ -162,25 +245,42 @@ func (b *BitStreamOps) Collect(numbits int) (ret uint, err error) {
 		return 0, errors.New("Invalid parameter value")
 	}
 
+	if b.order == BitOrderLSB {
+		return b.collectLSB(numbits)
+	}
+
 	for i := numbits - 1; i >= 0; i-- {
 		if b.bitindex == 8 {
 			b.index++
 			b.bitindex = 0
-			if b.bitindex == uint(len(b.buf)) {
-				return 0, errors.New("Buffer overrun")
+			b.refill()
+			if b.index == uint(len(b.buf)) {
+				return 0, ErrBufferOverrun
 			}
 		}
 		a := uint((b.buf[b.index]&(1<<(7-b.bitindex)))>>(7-b.bitindex)) << uint(i)
 		ret |= a
 		b.bitindex++
+	}
 
+	return
+}
+
+// collectLSB reverses emitLSB: the first bit read lands in the low bit of
+// ret and subsequent bits advance upward.
+func (b *BitStreamOps) collectLSB(numbits int) (ret uint, err error) {
+	for i := 0; i < numbits; i++ {
 		if b.bitindex == 8 {
 			b.index++
 			b.bitindex = 0
-			if b.bitindex == uint(len(b.buf)) {
-				return 0, errors.New("Buffer overrun")
+			b.refill()
+			if b.index == uint(len(b.buf)) {
+				return 0, ErrBufferOverrun
 			}
 		}
+		a := uint((b.buf[b.index]&(1<<b.bitindex))>>b.bitindex) << uint(i)
+		ret |= a
+		b.bitindex++
 	}
 
 	return
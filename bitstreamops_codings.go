@@ -0,0 +1,221 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * bitstreamops_codings.go: signed, unary, Elias gamma/delta and bit-level
+ * varint helpers built on top of Emit/Collect.
+ */
+
+package bitstreamops
+
+import "errors"
+
+// ErrValueOutOfRange is returned by the Elias/varint helpers when a value or
+// an encoded length doesn't fit the coding's constraints.
+var ErrValueOutOfRange = errors.New("bitstreamops: value out of range for this coding")
+
+// ErrEliasRequiresMSB is returned by the Elias gamma/delta helpers when
+// called on a BitOrderLSB stream. Their decoding hinges on the physical bit
+// immediately after the unary length prefix being n's most significant bit,
+// which only holds under BitOrderMSB -- emitLSB instead writes n's least
+// significant bit first.
+var ErrEliasRequiresMSB = errors.New("bitstreamops: Elias gamma/delta coding requires BitOrderMSB")
+
+// EmitSigned writes val's two's-complement representation in the low
+// numbits bits.
+func (b *BitStreamOps) EmitSigned(val int32, numbits int) error {
+	mask := uint(1)<<uint(numbits) - 1
+	return b.Emit(uint(uint32(val))&mask, numbits)
+}
+
+// CollectSigned reads numbits bits written by EmitSigned and sign-extends
+// them back to an int32.
+func (b *BitStreamOps) CollectSigned(numbits int) (int32, error) {
+	v, err := b.Collect(numbits)
+	if err != nil {
+		return 0, err
+	}
+	signBit := uint(1) << uint(numbits-1)
+	if v&signBit != 0 {
+		v |= ^uint(0) << uint(numbits)
+	}
+	return int32(v), nil
+}
+
+// EmitUnary writes n as a unary code: n one-bits followed by a terminating
+// zero-bit.
+func (b *BitStreamOps) EmitUnary(n uint) error {
+	for i := uint(0); i < n; i++ {
+		if err := b.Emit(1, 1); err != nil {
+			return err
+		}
+	}
+	return b.Emit(0, 1)
+}
+
+// CollectUnary reads back a unary code written by EmitUnary.
+func (b *BitStreamOps) CollectUnary() (uint, error) {
+	var n uint
+	for {
+		bit, err := b.Collect(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// EmitEliasGamma writes n (n >= 1) as an Elias gamma code: floor(log2(n))
+// zero-bits, followed by the floor(log2(n))+1 bit binary representation of n
+// (which starts with its implicit leading 1). Only supported on BitOrderMSB
+// streams; see ErrEliasRequiresMSB.
+func (b *BitStreamOps) EmitEliasGamma(n uint) error {
+	if b.order != BitOrderMSB {
+		return ErrEliasRequiresMSB
+	}
+	if n < 1 {
+		return ErrValueOutOfRange
+	}
+	l := bitLen(n) - 1
+	for i := 0; i < l; i++ {
+		if err := b.Emit(0, 1); err != nil {
+			return err
+		}
+	}
+	return b.Emit(n, l+1)
+}
+
+// CollectEliasGamma reads back a value written by EmitEliasGamma. Only
+// supported on BitOrderMSB streams; see ErrEliasRequiresMSB.
+func (b *BitStreamOps) CollectEliasGamma() (uint, error) {
+	if b.order != BitOrderMSB {
+		return 0, ErrEliasRequiresMSB
+	}
+	l, err := b.leadingZeros()
+	if err != nil {
+		return 0, err
+	}
+	if l == 0 {
+		return 1, nil
+	}
+	rest, err := b.Collect(l)
+	if err != nil {
+		return 0, err
+	}
+	return (uint(1) << uint(l)) | rest, nil
+}
+
+// EmitEliasDelta writes n (n >= 1) as an Elias delta code: an Elias gamma
+// code for floor(log2(n))+1, followed by the low floor(log2(n)) bits of n.
+// Only supported on BitOrderMSB streams; see ErrEliasRequiresMSB.
+func (b *BitStreamOps) EmitEliasDelta(n uint) error {
+	if n < 1 {
+		return ErrValueOutOfRange
+	}
+	l := bitLen(n) - 1
+	if err := b.EmitEliasGamma(uint(l + 1)); err != nil {
+		return err
+	}
+	if l == 0 {
+		return nil
+	}
+	return b.Emit(n, l)
+}
+
+// CollectEliasDelta reads back a value written by EmitEliasDelta. Only
+// supported on BitOrderMSB streams; see ErrEliasRequiresMSB.
+func (b *BitStreamOps) CollectEliasDelta() (uint, error) {
+	lPlus1, err := b.CollectEliasGamma()
+	if err != nil {
+		return 0, err
+	}
+	l := int(lPlus1) - 1
+	if l == 0 {
+		return 1, nil
+	}
+	rest, err := b.Collect(l)
+	if err != nil {
+		return 0, err
+	}
+	return (uint(1) << uint(l)) | rest, nil
+}
+
+// EmitVarUint writes v as a bit-level LEB128 varint: 7 bits of payload per
+// group plus a continuation bit, least-significant group first.
+func (b *BitStreamOps) EmitVarUint(v uint64) error {
+	for {
+		group := uint(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			if err := b.Emit(group|0x80, 8); err != nil {
+				return err
+			}
+			continue
+		}
+		return b.Emit(group, 8)
+	}
+}
+
+// CollectVarUint reads back a value written by EmitVarUint.
+func (b *BitStreamOps) CollectVarUint() (uint64, error) {
+	var result uint64
+	var shift uint
+	for {
+		group, err := b.Collect(8)
+		if err != nil {
+			return 0, err
+		}
+		result |= uint64(group&0x7f) << shift
+		if group&0x80 == 0 {
+			return result, nil
+		}
+		shift += 7
+		if shift >= 64 {
+			return 0, ErrValueOutOfRange
+		}
+	}
+}
+
+// leadingZeros counts (and consumes) leading zero-bits up to and including
+// the first one-bit, returning the count of zero-bits seen.
+func (b *BitStreamOps) leadingZeros() (int, error) {
+	l := 0
+	for {
+		bit, err := b.Collect(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return l, nil
+		}
+		l++
+	}
+}
+
+// bitLen returns the number of bits needed to represent n (n >= 1).
+func bitLen(n uint) int {
+	l := 0
+	for n > 0 {
+		l++
+		n >>= 1
+	}
+	return l
+}
@@ -0,0 +1,192 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * bitstreamops_fast.go: batched, accumulator-based bit I/O for high-throughput
+ * decoding/encoding (Huffman, FSE and similar entropy coders).
+ */
+
+package bitstreamops
+
+import "encoding/binary"
+
+// maxAccBits is the number of bits Fill/FillFast will top the accumulator up
+// to. Keeping a margin below 64 means a subsequent Peek/Advance never has to
+// worry about shifting a full 64-bit value.
+const maxAccBits = 56
+
+// Fill tops up the read accumulator one byte at a time from the underlying
+// buffer, stopping once it holds at least maxAccBits or the buffer is
+// exhausted. It is safe to call regardless of how many bytes remain; use
+// FillFast when at least 8 bytes are known to remain for a faster unaligned
+// read.
+func (b *BitStreamOps) Fill() {
+	for b.bitsInAcc < maxAccBits && int(b.index) < len(b.buf) {
+		if b.order == BitOrderLSB {
+			b.acc |= uint64(b.buf[b.index]) << b.bitsInAcc
+		} else {
+			b.acc |= uint64(b.buf[b.index]) << (56 - b.bitsInAcc)
+		}
+		b.index++
+		b.bitsInAcc += 8
+	}
+}
+
+// FillFast is like Fill but, when at least 8 bytes remain in the buffer,
+// tops up the accumulator with a single unaligned 64-bit read instead of a
+// byte-at-a-time loop. Callers on a hot path should check HasFastBytes and
+// fall back to Fill otherwise.
+func (b *BitStreamOps) FillFast() {
+	if b.bitsInAcc > maxAccBits || len(b.buf)-int(b.index) < 8 {
+		b.Fill()
+		return
+	}
+
+	want := (maxAccBits - b.bitsInAcc) / 8 * 8
+	if b.order == BitOrderLSB {
+		v := binary.LittleEndian.Uint64(b.buf[b.index:])
+		b.acc |= (v & (1<<want - 1)) << b.bitsInAcc
+	} else {
+		v := binary.BigEndian.Uint64(b.buf[b.index:])
+		// Right-justify the top `want` bits of the 8-byte read (the low
+		// 64-want bits belong to a byte we are not yet consuming -- b.index
+		// only advances by want/8 -- and must not leak into acc), then place
+		// them directly below the existing bitsInAcc valid bits at the top
+		// of the 64-bit word.
+		b.acc |= (v >> (64 - want)) << (64 - b.bitsInAcc - want)
+	}
+	b.index += want / 8
+	b.bitsInAcc += want
+}
+
+// HasFastBytes reports whether at least 8 bytes remain in the buffer, i.e.
+// whether FillFast can take its unaligned-read fast path.
+func (b *BitStreamOps) HasFastBytes() bool {
+	return len(b.buf)-int(b.index) >= 8
+}
+
+// Peek returns the next numbits bits of the accumulator without consuming
+// them. The caller must have Fill'd enough bits first.
+func (b *BitStreamOps) Peek(numbits int) uint64 {
+	if b.order == BitOrderLSB {
+		return b.acc & (1<<uint(numbits) - 1)
+	}
+	return b.acc >> (64 - uint(numbits))
+}
+
+// Advance consumes numbits bits from the accumulator previously returned by
+// Peek.
+func (b *BitStreamOps) Advance(numbits int) {
+	if b.order == BitOrderLSB {
+		b.acc >>= uint(numbits)
+	} else {
+		b.acc <<= uint(numbits)
+	}
+	b.bitsInAcc -= uint(numbits)
+}
+
+// GetBits is a fused Peek+Advance: it returns the next numbits bits and
+// consumes them in one call, refilling the accumulator first if it is
+// running low.
+func (b *BitStreamOps) GetBits(numbits int) uint64 {
+	if b.bitsInAcc < uint(numbits) {
+		b.Fill()
+	}
+	ret := b.Peek(numbits)
+	b.Advance(numbits)
+	return ret
+}
+
+// EmitFast appends the low numbits bits of val to the write accumulator,
+// flushing full bytes out to the underlying buffer once the accumulator
+// holds more than maxAccBits. Unlike Emit, EmitFast assumes the stream is
+// currently byte-aligned; call Flush before switching back to Emit/Collect.
+func (b *BitStreamOps) EmitFast(val uint64, numbits int) {
+	val &= 1<<uint(numbits) - 1
+
+	// wacc holds at most maxAccBits (56) valid bits on entry, but numbits
+	// can be as large as 24 (a typical Huffman/FSE code length), so
+	// b.wbits+numbits can exceed 64. OR-ing val in unflushed would shift it
+	// (or the merge shift amount itself) past the width of a uint64 and
+	// silently lose bits, so flush full bytes out of wacc first whenever
+	// there isn't room for the incoming value.
+	for b.wbits+uint(numbits) > 64 {
+		var by byte
+		if b.order == BitOrderLSB {
+			by = byte(b.wacc)
+			b.wacc >>= 8
+		} else {
+			by = byte(b.wacc >> 56)
+			b.wacc <<= 8
+		}
+		b.pushByte(by)
+		b.wbits -= 8
+	}
+
+	if b.order == BitOrderLSB {
+		b.wacc |= val << b.wbits
+	} else {
+		b.wacc |= val << (64 - b.wbits - uint(numbits))
+	}
+	b.wbits += uint(numbits)
+
+	for b.wbits > maxAccBits {
+		var by byte
+		if b.order == BitOrderLSB {
+			by = byte(b.wacc)
+			b.wacc >>= 8
+		} else {
+			by = byte(b.wacc >> 56)
+			b.wacc <<= 8
+		}
+		b.pushByte(by)
+		b.wbits -= 8
+	}
+}
+
+// Flush drains any remaining whole and partial bytes from the write
+// accumulator into the underlying buffer, zero-padding the final byte. It
+// leaves the stream byte-aligned.
+func (b *BitStreamOps) Flush() {
+	for b.wbits > 0 {
+		var by byte
+		if b.order == BitOrderLSB {
+			by = byte(b.wacc)
+			b.wacc >>= 8
+		} else {
+			by = byte(b.wacc >> 56)
+			b.wacc <<= 8
+		}
+		b.pushByte(by)
+		if b.wbits < 8 {
+			b.wbits = 0
+		} else {
+			b.wbits -= 8
+		}
+	}
+}
+
+// pushByte appends a single already-packed byte to the buffer, keeping the
+// trailing-placeholder-byte invariant the rest of this package relies on
+// (see EmitByte).
+func (b *BitStreamOps) pushByte(v byte) {
+	b.buf[b.index] = v
+	b.buf = append(b.buf, 0)
+	b.index++
+	b.bitindex = 0
+}
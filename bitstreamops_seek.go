@@ -0,0 +1,106 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * bitstreamops_seek.go: position checkpointing, seeking and zero-copy
+ * sub-range views, for decoders that need to speculatively parse and roll
+ * back.
+ */
+
+package bitstreamops
+
+import "errors"
+
+// ErrInvalidPosition is returned by Seek when the given BitPos does not fall
+// within the stream's buffer.
+var ErrInvalidPosition = errors.New("bitstreamops: position out of range")
+
+// BitPos is an opaque bit-granular position within a BitStreamOps' buffer,
+// as returned by Position/Tell and accepted by Seek/Restore.
+type BitPos struct {
+	byteIndex uint
+	bitIndex  uint
+}
+
+// Position returns the stream's current position.
+//
+// Collect leaves bitindex at 8 (rather than normalizing to the start of the
+// next byte) when a read ends exactly on a byte boundary, so that case is
+// folded here into {index+1, 0} before handing a BitPos out.
+func (b *BitStreamOps) Position() BitPos {
+	index, bitindex := b.index, b.bitindex
+	if bitindex == 8 {
+		index++
+		bitindex = 0
+	}
+	return BitPos{byteIndex: index, bitIndex: bitindex}
+}
+
+// Tell is an alias for Position, matching the conventional seek/tell naming.
+func (b *BitStreamOps) Tell() BitPos {
+	return b.Position()
+}
+
+// Seek moves the stream to a previously captured position.
+func (b *BitStreamOps) Seek(pos BitPos) error {
+	if pos.bitIndex > 7 {
+		return ErrInvalidPosition
+	}
+	if int(pos.byteIndex) > len(b.buf)-1 {
+		return ErrInvalidPosition
+	}
+	b.index = pos.byteIndex
+	b.bitindex = pos.bitIndex
+	return nil
+}
+
+// Save is a convenience alias for Position/Tell, meant to read naturally at
+// a speculative-decode call site: `cp := bs.Save(); ...; bs.Restore(cp)`.
+func (b *BitStreamOps) Save() BitPos {
+	return b.Position()
+}
+
+// Restore is a convenience alias for Seek, meant to pair with Save to back
+// out of a speculative decode (typically after ErrBufferOverrun).
+func (b *BitStreamOps) Restore(pos BitPos) error {
+	return b.Seek(pos)
+}
+
+// Sub returns a new BitStreamOps for reading the [start, end) bit range of
+// b's buffer. When end is not on a byte boundary the view runs to the end of
+// the byte holding end, so the bits of that byte after end are readable
+// through it too. It shares the underlying array with b rather than copying
+// it, so it is only valid as long as b's buffer is not mutated (e.g. via
+// Emit or Append); writes through the view are not prevented and land in
+// b's buffer.
+func (b *BitStreamOps) Sub(start, end BitPos) *BitStreamOps {
+	endByte := end.byteIndex
+	if end.bitIndex > 0 {
+		endByte++
+	}
+	if endByte > uint(len(b.buf)) {
+		endByte = uint(len(b.buf))
+	}
+
+	return &BitStreamOps{
+		buf:      b.buf[start.byteIndex:endByte],
+		index:    0,
+		bitindex: start.bitIndex,
+		order:    b.order,
+	}
+}
@@ -0,0 +1,355 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * bitstreamops_test.go: round-trip coverage for bit ordering, the fast
+ * accumulator path, the extra codings and seek/checkpoint helpers.
+ */
+
+package bitstreamops
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCollectExactlyToBufferEnd(t *testing.T) {
+	r := NewBitStreamOpsReader([]byte{0xFF})
+	got, err := r.Collect(8)
+	if err != nil {
+		t.Fatalf("Collect at exact buffer end: unexpected error: %v", err)
+	}
+	if got != 0xFF {
+		t.Fatalf("Collect at exact buffer end: got %#x, want 0xFF", got)
+	}
+
+	if _, err := r.Collect(1); err != ErrBufferOverrun {
+		t.Fatalf("Collect past buffer end: got err %v, want ErrBufferOverrun", err)
+	}
+}
+
+func TestEmitCollectRoundTripBothOrders(t *testing.T) {
+	values := []struct {
+		val  uint
+		bits int
+	}{
+		{0x1, 1},
+		{0x0, 1},
+		{0x5, 3},
+		{0xAB, 8},
+		{0x3FF, 10},
+		{0x12345, 20},
+	}
+
+	for _, order := range []BitOrder{BitOrderMSB, BitOrderLSB} {
+		w := NewBitStreamOpsWithOrder(order)
+		for _, v := range values {
+			if err := w.Emit(v.val, v.bits); err != nil {
+				t.Fatalf("order %v: Emit(%#x, %d): %v", order, v.val, v.bits, err)
+			}
+		}
+
+		r := NewBitStreamOpsReaderWithOrder(w.Buffer(), order)
+		for _, v := range values {
+			got, err := r.Collect(v.bits)
+			if err != nil {
+				t.Fatalf("order %v: Collect(%d): %v", order, v.bits, err)
+			}
+			if got != v.val {
+				t.Fatalf("order %v: Collect(%d) = %#x, want %#x", order, v.bits, got, v.val)
+			}
+		}
+	}
+}
+
+// TestLSBMatchesDeflateByteLayout hand-assembles a single fixed-Huffman
+// DEFLATE block using BitOrderLSB and checks that compress/flate's Reader
+// decodes it correctly, proving interop rather than just a hand-computed
+// byte layout. Per RFC 1951 3.1.1, multi-bit non-Huffman fields (BFINAL,
+// BTYPE) are packed least-significant-bit first -- exactly what Emit(val,
+// numbits) does in LSB mode -- while Huffman codes are packed starting with
+// the code's most-significant bit, so those are emitted one bit at a time
+// from the top down.
+func TestLSBMatchesDeflateByteLayout(t *testing.T) {
+	const msg = "tenta"
+
+	w := NewBitStreamOpsWithOrder(BitOrderLSB)
+	w.Emit(1, 1) // BFINAL: last block in the stream
+	w.Emit(1, 2) // BTYPE=01, fixed Huffman
+
+	emitFixedLiteral := func(lit byte) {
+		var code, size uint
+		if lit < 144 {
+			code, size = uint(lit)+0x30, 8
+		} else {
+			code, size = uint(lit)-144+0x190, 9
+		}
+		for i := int(size) - 1; i >= 0; i-- {
+			w.Emit((code>>uint(i))&1, 1)
+		}
+	}
+	for i := 0; i < len(msg); i++ {
+		emitFixedLiteral(msg[i])
+	}
+	for i := 0; i < 7; i++ { // end-of-block symbol 256, fixed code 0000000
+		w.Emit(0, 1)
+	}
+
+	got, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(w.Buffer())))
+	if err != nil {
+		t.Fatalf("flate.Reader on hand-assembled block: %v", err)
+	}
+	if string(got) != msg {
+		t.Fatalf("decoded %q, want %q", got, msg)
+	}
+}
+
+func TestFillAndFillFastAgree(t *testing.T) {
+	buf := make([]byte, 10)
+	for i := range buf {
+		buf[i] = byte(i + 1)
+	}
+
+	slow := NewBitStreamOpsReader(append([]byte(nil), buf...))
+	slow.Fill()
+
+	fast := NewBitStreamOpsReader(append([]byte(nil), buf...))
+	fast.FillFast()
+
+	if slow.bitsInAcc != fast.bitsInAcc {
+		t.Fatalf("Fill/FillFast disagree on bits loaded: Fill=%d FillFast=%d", slow.bitsInAcc, fast.bitsInAcc)
+	}
+	if slow.bitsInAcc > maxAccBits {
+		t.Fatalf("Fill loaded %d bits, want <= %d", slow.bitsInAcc, maxAccBits)
+	}
+	if slow.acc != fast.acc {
+		t.Fatalf("Fill/FillFast disagree on accumulator contents: Fill=%#x FillFast=%#x", slow.acc, fast.acc)
+	}
+}
+
+func TestGetBitsRoundTrip(t *testing.T) {
+	w := NewBitStreamOps()
+	w.EmitFast(0x3, 2)
+	w.EmitFast(0x7F, 7)
+	w.EmitFast(0x1, 1)
+	w.Flush()
+
+	r := NewBitStreamOpsReader(w.Buffer())
+	if got := r.GetBits(2); got != 0x3 {
+		t.Fatalf("GetBits(2) = %#x, want 0x3", got)
+	}
+	if got := r.GetBits(7); got != 0x7F {
+		t.Fatalf("GetBits(7) = %#x, want 0x7F", got)
+	}
+	if got := r.GetBits(1); got != 0x1 {
+		t.Fatalf("GetBits(1) = %#x, want 0x1", got)
+	}
+}
+
+// TestEmitFastAcrossAccumulatorBoundary is a regression test for a bug
+// where EmitFast merged val into wacc before flushing, so once the carried
+// wbits plus the new numbits exceeded 64 the merge shift either underflowed
+// (MSB mode) or shifted bits off the top of the word (LSB mode), silently
+// corrupting the value. 24-bit codes are the longest this package supports
+// (a realistic Huffman/FSE length) and three of them comfortably cross the
+// 64-bit boundary.
+func TestEmitFastAcrossAccumulatorBoundary(t *testing.T) {
+	values := []uint64{0x155555, 0x0AAAAA, 0x1FFFFF, 0x000000, 0x2AAAAA, 0x155555, 0x3FFFFF}
+
+	for _, order := range []BitOrder{BitOrderMSB, BitOrderLSB} {
+		w := NewBitStreamOpsWithOrder(order)
+		for _, v := range values {
+			w.EmitFast(v, 24)
+		}
+		w.Flush()
+
+		r := NewBitStreamOpsReaderWithOrder(w.Buffer(), order)
+		for i, want := range values {
+			if got := r.GetBits(24); got != want {
+				t.Fatalf("order=%v value %d: GetBits(24) = %#x, want %#x", order, i, got, want)
+			}
+		}
+	}
+}
+
+func TestSignedRoundTrip(t *testing.T) {
+	for _, v := range []int32{0, 1, -1, 15, -16, 63, -64} {
+		w := NewBitStreamOps()
+		if err := w.EmitSigned(v, 7); err != nil {
+			t.Fatalf("EmitSigned(%d, 7): %v", v, err)
+		}
+		r := NewBitStreamOpsReader(w.Buffer())
+		got, err := r.CollectSigned(7)
+		if err != nil {
+			t.Fatalf("CollectSigned after EmitSigned(%d, 7): %v", v, err)
+		}
+		if got != v {
+			t.Fatalf("CollectSigned round-trip of %d = %d", v, got)
+		}
+	}
+}
+
+func TestUnaryRoundTrip(t *testing.T) {
+	for _, n := range []uint{0, 1, 5, 20} {
+		w := NewBitStreamOps()
+		if err := w.EmitUnary(n); err != nil {
+			t.Fatalf("EmitUnary(%d): %v", n, err)
+		}
+		r := NewBitStreamOpsReader(w.Buffer())
+		got, err := r.CollectUnary()
+		if err != nil {
+			t.Fatalf("CollectUnary after EmitUnary(%d): %v", n, err)
+		}
+		if got != n {
+			t.Fatalf("CollectUnary round-trip of %d = %d", n, got)
+		}
+	}
+}
+
+func TestVarUintRoundTrip(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1 << 20, 1 << 40} {
+		w := NewBitStreamOps()
+		if err := w.EmitVarUint(v); err != nil {
+			t.Fatalf("EmitVarUint(%d): %v", v, err)
+		}
+		r := NewBitStreamOpsReader(w.Buffer())
+		got, err := r.CollectVarUint()
+		if err != nil {
+			t.Fatalf("CollectVarUint after EmitVarUint(%d): %v", v, err)
+		}
+		if got != v {
+			t.Fatalf("CollectVarUint round-trip of %d = %d", v, got)
+		}
+	}
+}
+
+func TestEliasGammaDeltaRoundTripMSB(t *testing.T) {
+	for _, n := range []uint{1, 2, 3, 4, 17, 100, 1000} {
+		w := NewBitStreamOps()
+		if err := w.EmitEliasGamma(n); err != nil {
+			t.Fatalf("EmitEliasGamma(%d): %v", n, err)
+		}
+		r := NewBitStreamOpsReader(w.Buffer())
+		got, err := r.CollectEliasGamma()
+		if err != nil {
+			t.Fatalf("CollectEliasGamma after EmitEliasGamma(%d): %v", n, err)
+		}
+		if got != n {
+			t.Fatalf("EliasGamma round-trip of %d = %d", n, got)
+		}
+
+		w2 := NewBitStreamOps()
+		if err := w2.EmitEliasDelta(n); err != nil {
+			t.Fatalf("EmitEliasDelta(%d): %v", n, err)
+		}
+		r2 := NewBitStreamOpsReader(w2.Buffer())
+		got2, err := r2.CollectEliasDelta()
+		if err != nil {
+			t.Fatalf("CollectEliasDelta after EmitEliasDelta(%d): %v", n, err)
+		}
+		if got2 != n {
+			t.Fatalf("EliasDelta round-trip of %d = %d", n, got2)
+		}
+	}
+}
+
+func TestEliasGammaRejectsLSB(t *testing.T) {
+	w := NewBitStreamOpsWithOrder(BitOrderLSB)
+	if err := w.EmitEliasGamma(2); err != ErrEliasRequiresMSB {
+		t.Fatalf("EmitEliasGamma on LSB stream: got err %v, want ErrEliasRequiresMSB", err)
+	}
+}
+
+func TestSeekSaveRestore(t *testing.T) {
+	w := NewBitStreamOps()
+	w.Emit(0x5, 4)
+	cp := w.Save()
+	w.Emit(0xA, 4)
+
+	if err := w.Restore(cp); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if w.Tell() != cp {
+		t.Fatalf("Restore did not land back on the checkpoint")
+	}
+}
+
+func TestSaveRestoreAfterByteAlignedCollect(t *testing.T) {
+	w := NewBitStreamOps()
+	w.Emit(0xAB, 8)
+	w.Emit(0x3, 4)
+
+	r := NewBitStreamOpsReader(w.Buffer())
+	if _, err := r.Collect(8); err != nil {
+		t.Fatalf("Collect(8): %v", err)
+	}
+
+	cp := r.Save()
+	if _, err := r.Collect(4); err != nil {
+		t.Fatalf("Collect(4): %v", err)
+	}
+	if err := r.Restore(cp); err != nil {
+		t.Fatalf("Restore after a byte-aligned Collect: %v", err)
+	}
+	if r.Tell() != cp {
+		t.Fatalf("Restore did not land back on the checkpoint")
+	}
+}
+
+func TestSubZeroCopyView(t *testing.T) {
+	w := NewBitStreamOps()
+	w.EmitByte(0xAA)
+	start := w.Tell()
+	w.EmitByte(0xBB)
+	end := w.Tell()
+	w.EmitByte(0xCC)
+
+	view := w.Sub(start, end)
+	got, err := view.CollectByte()
+	if err != nil {
+		t.Fatalf("CollectByte on Sub view: %v", err)
+	}
+	if got != 0xBB {
+		t.Fatalf("Sub view byte = %#x, want 0xBB", got)
+	}
+}
+
+// TestStreamCollectReadsFirstByte is a regression test for a bug where a
+// freshly-constructed NewBitStreamOpsStream reader silently fabricated its
+// first 8 bits as zero instead of refilling from src: refill was only
+// invoked from Collect's bitindex==8 byte-crossing path, which never fires
+// for the very first byte, so the real first byte of the stream was skipped
+// forever and everything after it shifted down by one byte.
+func TestStreamCollectReadsFirstByte(t *testing.T) {
+	src := bytes.NewReader([]byte{0xFF, 0x00, 0xFF, 0x00})
+	r := NewBitStreamOpsStream(src, nil)
+
+	var got uint
+	for i := 0; i < 32; i++ {
+		bit, err := r.Collect(1)
+		if err != nil {
+			t.Fatalf("Collect(1) bit %d: %v", i, err)
+		}
+		got = got<<1 | bit
+	}
+	if want := uint(0xFF00FF00); got != want {
+		t.Fatalf("Collect(1) x32 = %#08x, want %#08x", got, want)
+	}
+}
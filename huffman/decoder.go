@@ -0,0 +1,154 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * decoder.go: table-driven canonical Huffman decoding.
+ */
+
+package huffman
+
+import (
+	"errors"
+
+	"github.com/tenta-browser/go-bitstream-ops"
+)
+
+// ErrInvalidCode is returned by Decode when the next bits in the stream do
+// not form a valid code under the table the Decoder was built from.
+var ErrInvalidCode = errors.New("huffman: invalid code in stream")
+
+const maxRootBits = 9
+
+type rootEntry struct {
+	symbol uint16
+	length uint8 // 0 means "longer than rootBits, consult the overflow chain"
+}
+
+type overflowEntry struct {
+	value  uint32
+	length uint8
+	symbol uint16
+}
+
+// Decoder decodes symbols encoded by the canonical code described by a set
+// of per-symbol lengths (as produced by Codes.Lengths). It assumes the
+// BitStreamOps it reads from uses BitOrderMSB -- the bit order in which
+// canonical Huffman code values are conventionally defined.
+type Decoder struct {
+	rootBits int
+	root     []rootEntry
+	overflow map[uint32][]overflowEntry
+}
+
+// NewDecoder builds a Decoder from a set of per-symbol code lengths, using a
+// root lookup table (up to 9 bits) for short codes and an overflow chain for
+// codes longer than that.
+func NewDecoder(lengths []uint8) (*Decoder, error) {
+	maxLen := 0
+	for _, l := range lengths {
+		if int(l) > maxLen {
+			maxLen = int(l)
+		}
+	}
+	if maxLen == 0 {
+		return nil, ErrNoFrequencies
+	}
+
+	values := assignCanonicalValues(lengths)
+
+	rootBits := maxLen
+	if rootBits > maxRootBits {
+		rootBits = maxRootBits
+	}
+
+	d := &Decoder{
+		rootBits: rootBits,
+		root:     make([]rootEntry, 1<<uint(rootBits)),
+		overflow: make(map[uint32][]overflowEntry),
+	}
+
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		v := values[sym]
+		if int(l) <= rootBits {
+			pad := uint(rootBits) - uint(l)
+			base := v << pad
+			for i := uint32(0); i < 1<<pad; i++ {
+				d.root[base+i] = rootEntry{symbol: uint16(sym), length: l}
+			}
+			continue
+		}
+		prefix := v >> (uint(l) - uint(rootBits))
+		d.overflow[prefix] = append(d.overflow[prefix], overflowEntry{value: v, length: l, symbol: uint16(sym)})
+	}
+
+	return d, nil
+}
+
+// Decode reads one symbol from bs.
+func (d *Decoder) Decode(bs *bitstreamops.BitStreamOps) (uint16, error) {
+	bs.Fill()
+
+	idx := uint32(bs.Peek(d.rootBits))
+	e := d.root[idx]
+	if e.length != 0 {
+		bs.Advance(int(e.length))
+		return e.symbol, nil
+	}
+
+	for _, cand := range d.overflow[idx] {
+		if uint32(bs.Peek(int(cand.length))) == cand.value {
+			bs.Advance(int(cand.length))
+			return cand.symbol, nil
+		}
+	}
+
+	return 0, ErrInvalidCode
+}
+
+// assignCanonicalValues computes RFC 1951-style canonical code values for a
+// set of per-symbol lengths, independent of any particular Codes instance.
+func assignCanonicalValues(lengths []uint8) []uint32 {
+	var blCount [25]int
+	for _, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		blCount[l]++
+	}
+
+	var nextCode [25]uint32
+	var c uint32
+	maxLen := len(blCount) - 1
+	for bits := 1; bits <= maxLen; bits++ {
+		c = (c + uint32(blCount[bits-1])) << 1
+		nextCode[bits] = c
+	}
+
+	values := make([]uint32, len(lengths))
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		values[sym] = nextCode[l]
+		nextCode[l]++
+	}
+	return values
+}
@@ -0,0 +1,297 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * huffman.go: canonical Huffman code construction and encoding on top of
+ * BitStreamOps.
+ */
+
+// Package huffman implements canonical Huffman code construction, encoding
+// and decoding on top of bitstreamops.BitStreamOps, in the spirit of
+// klauspost/compress's huff0 but generic over the symbol alphabet.
+package huffman
+
+import (
+	"container/heap"
+	"errors"
+
+	"github.com/tenta-browser/go-bitstream-ops"
+)
+
+var (
+	ErrNoFrequencies   = errors.New("huffman: freqs has no non-zero entries")
+	ErrTooManySymbols  = errors.New("huffman: more than 65536 symbols")
+	ErrBadMaxBits      = errors.New("huffman: maxBits must be between 1 and 24")
+	ErrMaxBitsTooSmall = errors.New("huffman: maxBits is too small to encode every used symbol")
+	ErrUnknownSymbol   = errors.New("huffman: symbol has no assigned code")
+)
+
+// code pairs a canonical code value with its bit length.
+type code struct {
+	value  uint32
+	length uint8
+}
+
+// Codes is a canonical Huffman code table, indexed by symbol.
+type Codes struct {
+	table   []code // len(table) == number of symbols passed to BuildCodes
+	maxBits int
+}
+
+// Len reports the bit length assigned to symbol, or 0 if the symbol was
+// never observed (freqs[symbol] == 0).
+func (c *Codes) Len(symbol uint16) int {
+	if int(symbol) >= len(c.table) {
+		return 0
+	}
+	return int(c.table[symbol].length)
+}
+
+// Lengths returns the per-symbol code lengths, suitable for passing to
+// NewDecoder or SerializeLengths.
+func (c *Codes) Lengths() []uint8 {
+	out := make([]uint8, len(c.table))
+	for i, e := range c.table {
+		out[i] = e.length
+	}
+	return out
+}
+
+// Encode writes symbol's canonical code to bs.
+func (c *Codes) Encode(bs *bitstreamops.BitStreamOps, symbol uint16) error {
+	if int(symbol) >= len(c.table) || c.table[symbol].length == 0 {
+		return ErrUnknownSymbol
+	}
+	e := c.table[symbol]
+	return bs.Emit(uint(e.value), int(e.length))
+}
+
+// heapNode is a node of the Huffman merge tree. Leaves have symbol >= 0;
+// internal nodes have symbol == -1 and non-nil children.
+type heapNode struct {
+	freq        uint64
+	symbol      int
+	left, right *heapNode
+	order       int // insertion order, used as a freq tie-breaker
+}
+
+type nodeHeap []*heapNode
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].order < h[j].order
+}
+func (h nodeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(*heapNode)) }
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// BuildCodes derives a canonical, length-limited Huffman code for the given
+// symbol frequencies. freqs[i] is the frequency of symbol i; a zero
+// frequency means the symbol is unused and will not appear in the resulting
+// Codes. maxBits bounds the longest code length that may be produced (1-24);
+// when the natural Huffman tree would exceed it, lengths are rebalanced to
+// fit (see limitLengths). The rebalanced lengths form a valid prefix code but
+// not necessarily an optimal length-limited one.
+func BuildCodes(freqs []uint32, maxBits int) (*Codes, error) {
+	if maxBits < 1 || maxBits > 24 {
+		return nil, ErrBadMaxBits
+	}
+	if len(freqs) > 1<<16 {
+		return nil, ErrTooManySymbols
+	}
+
+	lengths := make([]uint8, len(freqs))
+
+	h := &nodeHeap{}
+	heap.Init(h)
+	order := 0
+	nonZero := 0
+	var lone int = -1
+	for sym, f := range freqs {
+		if f == 0 {
+			continue
+		}
+		nonZero++
+		lone = sym
+		heap.Push(h, &heapNode{freq: uint64(f), symbol: sym, order: order})
+		order++
+	}
+	if nonZero == 0 {
+		return nil, ErrNoFrequencies
+	}
+	if nonZero > 1<<uint(maxBits) {
+		return nil, ErrMaxBitsTooSmall
+	}
+	if nonZero == 1 {
+		// A single symbol still needs a (1-bit) code to be emitted.
+		lengths[lone] = 1
+		return finishCodes(lengths, maxBits)
+	}
+
+	for h.Len() > 1 {
+		a := heap.Pop(h).(*heapNode)
+		b := heap.Pop(h).(*heapNode)
+		heap.Push(h, &heapNode{freq: a.freq + b.freq, symbol: -1, left: a, right: b, order: order})
+		order++
+	}
+	root := heap.Pop(h).(*heapNode)
+	assignDepths(root, 0, lengths)
+
+	limitLengths(lengths, maxBits)
+
+	return finishCodes(lengths, maxBits)
+}
+
+func assignDepths(n *heapNode, depth int, lengths []uint8) {
+	if n.symbol >= 0 {
+		if depth == 0 {
+			depth = 1 // single-symbol subtree edge case
+		}
+		lengths[n.symbol] = uint8(depth)
+		return
+	}
+	assignDepths(n.left, depth+1, lengths)
+	assignDepths(n.right, depth+1, lengths)
+}
+
+// limitLengths rebalances a length assignment so that no length exceeds
+// maxBits, using an "overflow into a histogram, then borrow back" scheme
+// modelled on zlib's gen_bitlen, except that it borrows from the shortest
+// used length rather than the longest one below maxBits. It preserves the
+// Kraft inequality, so the result is always a valid prefix code; it can
+// lengthen the codes of the most frequent symbols well past their optimal
+// length-limited lengths.
+func limitLengths(lengths []uint8, maxBits int) {
+	maxLen := 0
+	for _, l := range lengths {
+		if int(l) > maxLen {
+			maxLen = int(l)
+		}
+	}
+	if maxLen <= maxBits {
+		return
+	}
+
+	counts := make([]int, maxLen+1)
+	for _, l := range lengths {
+		if l > 0 {
+			counts[l]++
+		}
+	}
+
+	overflow := 0
+	for l := maxLen; l > maxBits; l-- {
+		overflow += counts[l]
+		counts[l] = 0
+	}
+	counts[maxBits] += overflow
+
+	// The fold above can leave the Kraft sum over-subscribed: folding a
+	// symbol from length l>maxBits down to maxBits only ever *shortens* it,
+	// so sum(counts[l]*2^(maxBits-l)) can end up above 1<<maxBits. Track
+	// that sum directly (scaled by 2^maxBits so it stays integral) rather
+	// than trusting the pre-fold overflow count, which has no fixed
+	// relationship to how much Kraft-sum mass actually needs removing.
+	full := 1 << uint(maxBits)
+	excess := -full
+	for l := 1; l <= maxBits; l++ {
+		excess += counts[l] << uint(maxBits-l)
+	}
+
+	// Rebalancing after zlib's gen_bitlen: each step takes one symbol from
+	// a length below maxBits that still has one, bumps it to length+1, and
+	// frees up the slot at maxBits that its extra sibling had been
+	// squatting in. Each step reduces the scaled Kraft sum by exactly 1, so
+	// looping until excess reaches 0 leaves the code valid. Always taking
+	// from the *shortest* available length (rather than the longest, i.e.
+	// maxBits-1) spreads the promoted symbols across the lower lengths
+	// instead of repeatedly feeding the same near-maxBits bucket straight
+	// back into maxBits.
+	for excess > 0 {
+		l := 1
+		for counts[l] == 0 {
+			l++
+		}
+		counts[l]--
+		counts[l+1] += 2
+		counts[maxBits]--
+		excess--
+	}
+
+	// Re-assign lengths from the corrected histogram: symbols that
+	// originally needed a longer code are, in order of decreasing original
+	// length, handed the longest still-available slot. A higher-frequency
+	// (originally shorter-coded) symbol thus never ends up with a longer code
+	// than a lower-frequency one.
+	type sl struct {
+		symbol int
+		length uint8
+	}
+	var symbols []sl
+	for sym, l := range lengths {
+		if l > 0 {
+			symbols = append(symbols, sl{sym, l})
+		}
+	}
+	// Stable sort by original length descending so the symbols that most
+	// needed a long code are reassigned first, longest-available-slot first.
+	for i := 1; i < len(symbols); i++ {
+		for j := i; j > 0 && symbols[j].length > symbols[j-1].length; j-- {
+			symbols[j], symbols[j-1] = symbols[j-1], symbols[j]
+		}
+	}
+
+	l := maxBits
+	for _, s := range symbols {
+		for l >= 1 && counts[l] == 0 {
+			l--
+		}
+		if l < 1 {
+			l = 1
+		}
+		lengths[s.symbol] = uint8(l)
+		counts[l]--
+	}
+}
+
+// finishCodes assigns canonical code values to a finished (and already
+// length-limited) set of per-symbol lengths, per the RFC 1951 algorithm:
+// codes are assigned in order of increasing symbol value, with the first
+// code of each length derived from how many shorter codes precede it.
+func finishCodes(lengths []uint8, maxBits int) (*Codes, error) {
+	values := assignCanonicalValues(lengths)
+
+	table := make([]code, len(lengths))
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		table[sym] = code{value: values[sym], length: l}
+	}
+
+	return &Codes{table: table, maxBits: maxBits}, nil
+}
@@ -0,0 +1,146 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * huffman_test.go: code construction, encode/decode round trip and
+ * length-limiting coverage.
+ */
+
+package huffman
+
+import (
+	"testing"
+
+	"github.com/tenta-browser/go-bitstream-ops"
+)
+
+func TestBuildCodesEncodeDecodeRoundTrip(t *testing.T) {
+	freqs := []uint32{5, 1, 1, 2, 8, 0, 3}
+	symbols := []uint16{0, 1, 2, 3, 4, 6, 6, 4, 0}
+
+	codes, err := BuildCodes(freqs, 8)
+	if err != nil {
+		t.Fatalf("BuildCodes: %v", err)
+	}
+
+	w := bitstreamops.NewBitStreamOps()
+	for _, s := range symbols {
+		if err := codes.Encode(w, s); err != nil {
+			t.Fatalf("Encode(%d): %v", s, err)
+		}
+	}
+
+	dec, err := NewDecoder(codes.Lengths())
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+
+	r := bitstreamops.NewBitStreamOpsReader(w.Buffer())
+	for i, want := range symbols {
+		got, err := dec.Decode(r)
+		if err != nil {
+			t.Fatalf("Decode symbol %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("Decode symbol %d = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestSerializeDeserializeLengths(t *testing.T) {
+	freqs := []uint32{5, 1, 1, 2, 8, 0, 3}
+	codes, err := BuildCodes(freqs, 8)
+	if err != nil {
+		t.Fatalf("BuildCodes: %v", err)
+	}
+
+	w := bitstreamops.NewBitStreamOps()
+	SerializeLengths(w, codes.Lengths())
+
+	r := bitstreamops.NewBitStreamOpsReader(w.Buffer())
+	got, err := DeserializeLengths(r)
+	if err != nil {
+		t.Fatalf("DeserializeLengths: %v", err)
+	}
+
+	want := codes.Lengths()
+	if len(got) != len(want) {
+		t.Fatalf("DeserializeLengths length = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("length[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+// TestBuildCodesRespectsMaxBits is a regression test for a length-limiting
+// bug where the rebalancing loop over-corrected and piled far more symbols
+// onto maxBits than necessary. It uses a Fibonacci-weighted frequency set,
+// which produces a deep, unbalanced tree that needs real length limiting at
+// a small maxBits.
+func TestBuildCodesRespectsMaxBits(t *testing.T) {
+	const n = 20
+	const maxBits = 8
+
+	freqs := make([]uint32, n)
+	freqs[0], freqs[1] = 1, 1
+	for i := 2; i < n; i++ {
+		freqs[i] = freqs[i-1] + freqs[i-2]
+	}
+
+	codes, err := BuildCodes(freqs, maxBits)
+	if err != nil {
+		t.Fatalf("BuildCodes: %v", err)
+	}
+
+	longest := 0
+	atMaxBits := 0
+	for sym := range freqs {
+		l := codes.Len(uint16(sym))
+		if l == 0 {
+			t.Fatalf("symbol %d got no code", sym)
+		}
+		if l > longest {
+			longest = l
+		}
+		if l == maxBits {
+			atMaxBits++
+		}
+	}
+	if longest > maxBits {
+		t.Fatalf("longest code = %d bits, want <= %d", longest, maxBits)
+	}
+	// The unbalanced Fibonacci tree only forces a handful of the
+	// least-frequent symbols down to maxBits; a correct rebalance should
+	// not need anywhere close to a majority of the alphabet there.
+	if atMaxBits > n/2 {
+		t.Fatalf("%d of %d symbols forced to maxBits, want a small minority", atMaxBits, n)
+	}
+}
+
+// TestBuildCodesRejectsInfeasibleMaxBits is a regression test for a missing
+// feasibility check: a maxBits too small to give every used symbol a
+// distinct prefix-free code (2^maxBits < nonZero) must be rejected rather
+// than silently handed back as an over-subscribed, undecodable table.
+func TestBuildCodesRejectsInfeasibleMaxBits(t *testing.T) {
+	freqs := []uint32{1, 1, 1, 1, 1}
+	if _, err := BuildCodes(freqs, 1); err != ErrMaxBitsTooSmall {
+		t.Fatalf("BuildCodes(freqs, 1) with 5 used symbols: err = %v, want ErrMaxBitsTooSmall", err)
+	}
+}
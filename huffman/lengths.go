@@ -0,0 +1,74 @@
+/**
+ * Go Bitstream Ops
+ *
+ *    Copyright 2017 Tenta, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * For any questions, please contact developer@tenta.io
+ *
+ * lengths.go: run-length-encoded serialization of a code-length table, so a
+ * Decoder can be reconstructed on the other end without retransmitting the
+ * original frequencies.
+ */
+
+package huffman
+
+import "github.com/tenta-browser/go-bitstream-ops"
+
+// SerializeLengths writes lengths to bs as a byte-aligned, RFC 1951-style
+// run-length encoding: a symbol count, followed by (length, run count)
+// pairs. Runs longer than 65535 are split across multiple pairs.
+func SerializeLengths(bs *bitstreamops.BitStreamOps, lengths []uint8) {
+	bs.JumpToNextByte()
+	bs.EmitDWord(uint32(len(lengths)))
+
+	i := 0
+	for i < len(lengths) {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l && run < 0xffff {
+			run++
+		}
+		bs.EmitByte(l)
+		bs.EmitWord(uint16(run))
+		i += run
+	}
+}
+
+// DeserializeLengths reads back a code-length table previously written by
+// SerializeLengths.
+func DeserializeLengths(bs *bitstreamops.BitStreamOps) ([]uint8, error) {
+	bs.JumpToNextByteForRead()
+	n, err := bs.CollectDWord()
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := make([]uint8, 0, n)
+	for uint(len(lengths)) < n {
+		l, err := bs.CollectByte()
+		if err != nil {
+			return nil, err
+		}
+		run, err := bs.CollectWord()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint(0); i < run; i++ {
+			lengths = append(lengths, uint8(l))
+		}
+	}
+
+	return lengths, nil
+}